@@ -17,10 +17,27 @@ package controllerutils
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
+	"golang.org/x/sync/errgroup"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+// HARunnable is a Runnable that explicitly declares whether it requires leader election. It mirrors
+// manager.LeaderElectionRunnable, but is used to identify runnables that must run on every replica of a
+// highly-available deployment (e.g. webhook servers, health or metric endpoints), independent of leadership.
+type HARunnable interface {
+	manager.Runnable
+	// NeedLeaderElection returns false if the runnable does not require leader election, i.e. it should be started
+	// immediately on all replicas instead of waiting for leadership to be acquired.
+	NeedLeaderElection() bool
+}
+
 // ControlledRunner is a Runnable for the controller-runtime manager which can be used to control complex start-up
 // sequences of controllers. It allows to first run a set of bootstrap runnables before adding the actual runnables to
 // the manager. When the manager is started, this runner first runs all bootstrapping runnables before adding the actual
@@ -29,32 +46,409 @@ type ControlledRunner struct {
 	// Manager is the controller-runtime manager.
 	Manager manager.Manager
 	// BootstrapRunnables are the runnables that are responsible for bootstrapping tasks. They will be started
-	// sequentially in the provided order.
+	// sequentially in the provided order. Ignored if BootstrapGroups is set.
 	BootstrapRunnables []manager.Runnable
+	// BootstrapGroups are, like BootstrapRunnables, responsible for bootstrapping tasks, but organised into
+	// sequential stages: the runnables within a group are started concurrently, while groups themselves are started
+	// one after another, so that a later group can rely on an earlier one having completed (e.g. webhook cert
+	// generation depending on CRD registration). If set, it takes precedence over BootstrapRunnables.
+	BootstrapGroups [][]manager.Runnable
+	// MaxConcurrency bounds how many runnables within a single bootstrap group are started concurrently. Zero
+	// means unbounded.
+	MaxConcurrency int
 	// ActualRunnables are the runnables that are responsible for the actual tasks of the controller. They will be added
 	// sequentially in the provided order, however they will be started immediately if the manager is already started.
 	ActualRunnables []manager.Runnable
+	// HARunnables are runnables that must run on every replica of a highly-available deployment regardless of
+	// leader election, such as webhook servers or health and metric endpoints. They are added to the manager by
+	// Start alongside ActualRunnables and are wrapped so that the manager does not gate them on leadership. Start
+	// itself only runs once the manager starts the ControlledRunner, which does not implement NeedLeaderElection and
+	// is therefore started by the manager only after leadership has been acquired.
+	HARunnables []manager.Runnable
+	// BootstrapRetryBackoff configures retries performed when a bootstrap runnable's Start fails, e.g. due to
+	// transient API server errors while installing CRDs or webhooks. A zero value disables retries, i.e. the first
+	// error is returned immediately, preserving prior behaviour.
+	BootstrapRetryBackoff wait.Backoff
+	// RunnableRetryBackoff configures retries performed when ActualRunnables or HARunnables fail to start after
+	// being added to the manager, giving eventual-consistency semantics when dependent services are momentarily
+	// unavailable. A zero value disables retries.
+	RunnableRetryBackoff wait.Backoff
+	// ShutdownTimeout bounds how long Stop waits for ActualRunnables and HARunnables to return after being
+	// signalled to stop, and separately how long it waits for bootstrap runnables (from BootstrapGroups, or
+	// BootstrapRunnables if BootstrapGroups is not set) that implement Closer to tear down, before giving up and
+	// moving on regardless. A zero value means Stop waits indefinitely.
+	ShutdownTimeout time.Duration
+
+	mu      sync.Mutex
+	ready   bool
+	tracked []*trackedRunnable
+}
+
+// Closer may optionally be implemented by a BootstrapRunnable to release resources it acquired during bootstrapping
+// (e.g. temporary clients or caches) once the ControlledRunner is stopped.
+type Closer interface {
+	Close() error
 }
 
-// Start starts the runner.
+// Start starts the runner. It first runs the bootstrap stages (BootstrapGroups, or BootstrapRunnables run as one
+// runnable per stage if BootstrapGroups is not set), running the runnables within a stage concurrently and waiting
+// for a stage to complete before starting the next one, then registers a readyz and healthz check on the Manager,
+// adds HARunnables and ActualRunnables to the Manager, and waits for each of them to have actually been started by
+// the Manager before reporting ready.
 func (c *ControlledRunner) Start(ctx context.Context) error {
-	for _, runnable := range c.BootstrapRunnables {
-		if err := runnable.Start(ctx); err != nil {
+	for _, group := range c.bootstrapGroups() {
+		if err := c.runBootstrapGroup(ctx, group); err != nil {
 			return fmt.Errorf("failed during bootstrapping: %w", err)
 		}
 	}
 
-	return AddAllRunnables(c.Manager, c.ActualRunnables...)
+	if err := c.Manager.AddReadyzCheck("controlled-runner", c.readyzCheck); err != nil {
+		return fmt.Errorf("failed adding readyz check: %w", err)
+	}
+	if err := c.Manager.AddHealthzCheck("controlled-runner", healthz.Ping); err != nil {
+		return fmt.Errorf("failed adding healthz check: %w", err)
+	}
+
+	haTracked, err := c.addTrackedRunnables(c.HARunnables, true)
+	if err != nil {
+		return err
+	}
+	actualTracked, err := c.addTrackedRunnables(c.ActualRunnables, false)
+	if err != nil {
+		return err
+	}
+
+	if err := awaitStarted(ctx, append(haTracked, actualTracked...)); err != nil {
+		return fmt.Errorf("failed waiting for runnables to start: %w", err)
+	}
+
+	c.mu.Lock()
+	c.ready = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// readyzCheck reports ready only once bootstrapping has completed and all HARunnables and ActualRunnables have
+// actually signalled that the Manager started them, closing the race where the Manager reports healthy while the
+// cache is still warming or webhook bootstrap is incomplete.
+func (c *ControlledRunner) readyzCheck(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready {
+		return fmt.Errorf("controlled runner is not yet ready: waiting for bootstrap and runnable start-up to complete")
+	}
+
+	return nil
+}
+
+// awaitStarted blocks until every tracked runnable has signalled that its Start has been invoked, or ctx is done,
+// whichever happens first.
+func awaitStarted(ctx context.Context, tracked []*trackedRunnable) error {
+	for _, tr := range tracked {
+		select {
+		case <-tr.started:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Stop gracefully tears down the runner in the reverse order of Start: it first cancels HARunnables and
+// ActualRunnables and waits up to ShutdownTimeout for each to return, then tears down any bootstrap runnable (from
+// BootstrapGroups, or BootstrapRunnables if BootstrapGroups is not set, mirroring the precedence bootstrapGroups
+// applies on Start) that implements Closer, again waiting up to ShutdownTimeout. It does not return an error for
+// HARunnables or ActualRunnables that fail to stop within the timeout. The returned error is the first one
+// encountered while closing bootstrap runnables, including a Close that did not return within ShutdownTimeout;
+// later errors are not returned.
+func (c *ControlledRunner) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	tracked := make([]*trackedRunnable, len(c.tracked))
+	copy(tracked, c.tracked)
+	c.mu.Unlock()
+
+	for i := len(tracked) - 1; i >= 0; i-- {
+		tracked[i].stop(c.ShutdownTimeout)
+	}
+
+	var firstErr error
+	for _, group := range c.bootstrapGroups() {
+		for _, runnable := range group {
+			closer, ok := runnable.(Closer)
+			if !ok {
+				continue
+			}
+
+			if err := closeWithTimeout(ctx, closer, c.ShutdownTimeout); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed tearing down bootstrap resource: %w", err)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// bootstrapGroups returns BootstrapGroups if set, falling back to one single-runnable group per entry in
+// BootstrapRunnables so that unconfigured callers keep the prior strictly-sequential behaviour.
+func (c *ControlledRunner) bootstrapGroups() [][]manager.Runnable {
+	if len(c.BootstrapGroups) > 0 {
+		return c.BootstrapGroups
+	}
+
+	groups := make([][]manager.Runnable, 0, len(c.BootstrapRunnables))
+	for _, runnable := range c.BootstrapRunnables {
+		groups = append(groups, []manager.Runnable{runnable})
+	}
+
+	return groups
+}
+
+// runBootstrapGroup starts every runnable in the group concurrently, bounded by MaxConcurrency, cancelling the
+// remaining siblings as soon as one of them fails, and returns an aggregated error once all of them have returned.
+func (c *ControlledRunner) runBootstrapGroup(ctx context.Context, group []manager.Runnable) error {
+	g, gCtx := errgroup.WithContext(ctx)
+	if c.MaxConcurrency > 0 {
+		g.SetLimit(c.MaxConcurrency)
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, runnable := range group {
+		runnable := runnable
+		g.Go(func() error {
+			if err := startWithRetry(gCtx, runnable, c.BootstrapRetryBackoff); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	return nil
+}
+
+// addTrackedRunnables adds the given runnables to the manager, wrapping each so that Stop can cancel it individually
+// and wait for it to return, and so that Start can wait for the Manager to have actually started it (see
+// trackedRunnable.started). If forceNonLeaderElection is true, every runnable is forced to skip leader election
+// regardless of whether it declares a preference itself (or declares none at all), which is what lets a plain
+// manager.Runnable placed in HARunnables (e.g. a bare manager.RunnableFunc for a metrics endpoint) run on every
+// replica instead of being gated on leadership by controller-runtime's own "needs leader election unless it says
+// otherwise" default. It returns the trackedRunnable wrapping each added runnable, in the same order.
+func (c *ControlledRunner) addTrackedRunnables(runnables []manager.Runnable, forceNonLeaderElection bool) ([]*trackedRunnable, error) {
+	tracked := make([]*trackedRunnable, 0, len(runnables))
+
+	for _, r := range runnables {
+		wrapped := toManagerRunnable(r, forceNonLeaderElection)
+		if c.RunnableRetryBackoff.Steps > 1 {
+			wrapped = &retryingRunnable{Runnable: wrapped, backoff: c.RunnableRetryBackoff}
+		}
+
+		tr := &trackedRunnable{Runnable: wrapped, started: make(chan struct{}), done: make(chan struct{})}
+		tracked = append(tracked, tr)
+
+		c.mu.Lock()
+		c.tracked = append(c.tracked, tr)
+		c.mu.Unlock()
+
+		if err := c.Manager.Add(tr); err != nil {
+			return nil, fmt.Errorf("failed adding runnable to manager: %w", err)
+		}
+	}
+
+	return tracked, nil
 }
 
-// AddAllRunnables loops over the provided runnables and adds them to the manager. It returns an error immediately if
+// AddAllRunnables loops over the provided runnables and adds them to the manager. Runnables that implement
+// HARunnable and report that they do not need leader election are wrapped so that the manager starts them
+// immediately on all replicas instead of gating them on leadership, allowing active/active HA topologies (e.g. for
+// webhook servers) without blocking on lease acquisition. If backoff.Steps is greater than 1, each runnable's Start
+// is retried according to it instead of failing the manager on the first transient error. It returns an error immediately if
 // adding fails.
-func AddAllRunnables(mgr manager.Manager, runnables ...manager.Runnable) error {
+func AddAllRunnables(mgr manager.Manager, backoff wait.Backoff, runnables ...manager.Runnable) error {
 	for _, r := range runnables {
-		if err := mgr.Add(r); err != nil {
+		wrapped := toManagerRunnable(r, false)
+		if backoff.Steps > 1 {
+			wrapped = &retryingRunnable{Runnable: wrapped, backoff: backoff}
+		}
+		if err := mgr.Add(wrapped); err != nil {
 			return fmt.Errorf("failed adding runnable to manager: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// startWithRetry starts the given runnable, retrying according to backoff if it fails. A zero-value backoff
+// disables retries, starting the runnable exactly once. It uses wait.ExponentialBackoffWithContext rather than
+// wait.ExponentialBackoff so that ctx being cancelled between attempts (e.g. because a sibling in the same
+// bootstrap group already failed, or ControlledRunner.Stop cancelled this runnable) actually aborts the retry loop
+// instead of sleeping/retrying through its full backoff budget regardless.
+func startWithRetry(ctx context.Context, r manager.Runnable, backoff wait.Backoff) error {
+	if backoff.Steps <= 1 {
+		return r.Start(ctx)
+	}
+
+	var lastErr error
+	if err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		if lastErr = r.Start(ctx); lastErr != nil {
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		if lastErr != nil {
+			return lastErr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// toManagerRunnable adapts a runnable to controller-runtime's own LeaderElectionRunnable contract so that the
+// manager can correctly decide whether to gate it on leader election. If forceNonLeaderElection is true, the
+// runnable is always wrapped to report that it does not need leader election, overriding any preference it may (or
+// may not) declare itself; this is used for HARunnables, which must run on every replica regardless of whether they
+// happen to implement HARunnable themselves.
+func toManagerRunnable(r manager.Runnable, forceNonLeaderElection bool) manager.Runnable {
+	if forceNonLeaderElection {
+		return &leaderElectionRunnable{Runnable: r, needsLeaderElection: false}
+	}
+
+	if ha, ok := r.(HARunnable); ok {
+		return &leaderElectionRunnable{Runnable: ha, needsLeaderElection: ha.NeedLeaderElection()}
+	}
+
+	return r
+}
+
+// leaderElectionRunnable wraps a runnable together with a fixed leader election requirement, implementing
+// controller-runtime's manager.LeaderElectionRunnable interface.
+type leaderElectionRunnable struct {
+	manager.Runnable
+	needsLeaderElection bool
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (l *leaderElectionRunnable) NeedLeaderElection() bool {
+	return l.needsLeaderElection
+}
+
+// retryingRunnable wraps a runnable so that the manager retries its Start according to backoff instead of tearing
+// down the manager on the first transient error.
+type retryingRunnable struct {
+	manager.Runnable
+	backoff wait.Backoff
+}
+
+// Start implements manager.Runnable.
+func (r *retryingRunnable) Start(ctx context.Context) error {
+	return startWithRetry(ctx, r.Runnable, r.backoff)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. It defers to the wrapped runnable if it declares a
+// preference, defaulting to true (requiring leader election) to match controller-runtime's own default for
+// runnables that do not implement the interface.
+func (r *retryingRunnable) NeedLeaderElection() bool {
+	if le, ok := r.Runnable.(interface{ NeedLeaderElection() bool }); ok {
+		return le.NeedLeaderElection()
+	}
+
+	return true
+}
+
+// trackedRunnable wraps a runnable so that ControlledRunner.Stop can cancel it individually, independent of the
+// Manager's own root context, and wait for it to return. It also closes started as soon as the Manager actually
+// invokes Start, which ControlledRunner.Start waits on before reporting ready, instead of assuming a runnable has
+// started as soon as it was handed to Manager.Add (which only schedules it to run and returns immediately).
+type trackedRunnable struct {
+	manager.Runnable
+
+	started chan struct{}
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start implements manager.Runnable.
+func (t *trackedRunnable) Start(ctx context.Context) error {
+	close(t.started)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	defer close(t.done)
+
+	return t.Runnable.Start(ctx)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, deferring to the wrapped runnable.
+func (t *trackedRunnable) NeedLeaderElection() bool {
+	if le, ok := t.Runnable.(interface{ NeedLeaderElection() bool }); ok {
+		return le.NeedLeaderElection()
+	}
+
+	return true
+}
+
+// stop cancels the runnable's context, if it has started, and waits up to timeout for it to return. A zero timeout
+// means it waits indefinitely.
+func (t *trackedRunnable) stop(timeout time.Duration) {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	if timeout <= 0 {
+		<-t.done
+		return
+	}
+
+	select {
+	case <-t.done:
+	case <-time.After(timeout):
+	}
+}
+
+// closeWithTimeout calls closer.Close, giving up and returning early once timeout elapses. A zero timeout means it
+// waits indefinitely for Close to return.
+func closeWithTimeout(ctx context.Context, closer Closer, timeout time.Duration) error {
+	if timeout <= 0 {
+		return closer.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- closer.Close()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
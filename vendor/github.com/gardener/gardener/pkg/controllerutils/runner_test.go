@@ -0,0 +1,303 @@
+// Copyright 2022 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllerutils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+func needLeaderElection(t *testing.T, r manager.Runnable) bool {
+	t.Helper()
+
+	le, ok := r.(interface{ NeedLeaderElection() bool })
+	if !ok {
+		t.Fatalf("runnable %T does not implement NeedLeaderElection", r)
+	}
+
+	return le.NeedLeaderElection()
+}
+
+func TestToManagerRunnable_ForceNonLeaderElectionOverridesPlainRunnable(t *testing.T) {
+	// A bare manager.RunnableFunc (e.g. a metrics endpoint) does not implement HARunnable at all.
+	plain := manager.RunnableFunc(func(_ context.Context) error { return nil })
+
+	wrapped := toManagerRunnable(plain, true)
+
+	if needLeaderElection(t, wrapped) {
+		t.Error("expected forceNonLeaderElection to make the wrapped runnable report NeedLeaderElection() == false")
+	}
+}
+
+func TestToManagerRunnable_ForceNonLeaderElectionOverridesSelfDeclaringHARunnable(t *testing.T) {
+	// Even a runnable that declares itself as requiring leader election must be overridden when it is placed in
+	// HARunnables.
+	self := &fakeHARunnable{needsLeaderElection: true}
+
+	wrapped := toManagerRunnable(self, true)
+
+	if needLeaderElection(t, wrapped) {
+		t.Error("expected forceNonLeaderElection to override the runnable's own NeedLeaderElection() declaration")
+	}
+}
+
+func TestToManagerRunnable_WithoutForceRespectsHARunnableDeclaration(t *testing.T) {
+	self := &fakeHARunnable{needsLeaderElection: false}
+
+	wrapped := toManagerRunnable(self, false)
+
+	if needLeaderElection(t, wrapped) {
+		t.Error("expected the HARunnable's own declaration to be respected when not forced")
+	}
+}
+
+func TestToManagerRunnable_WithoutForceLeavesPlainRunnableUnwrapped(t *testing.T) {
+	plain := manager.RunnableFunc(func(_ context.Context) error { return nil })
+
+	wrapped := toManagerRunnable(plain, false)
+
+	if _, ok := wrapped.(interface{ NeedLeaderElection() bool }); ok {
+		t.Error("expected a plain runnable to pass through unwrapped when not forced")
+	}
+}
+
+type fakeHARunnable struct {
+	needsLeaderElection bool
+}
+
+func (f *fakeHARunnable) Start(_ context.Context) error { return nil }
+
+func (f *fakeHARunnable) NeedLeaderElection() bool { return f.needsLeaderElection }
+
+func TestReadyzCheck_BeforeAndAfterReady(t *testing.T) {
+	c := &ControlledRunner{}
+
+	if err := c.readyzCheck(nil); err == nil {
+		t.Error("expected readyzCheck to report not-ready before Start has completed")
+	}
+
+	c.mu.Lock()
+	c.ready = true
+	c.mu.Unlock()
+
+	if err := c.readyzCheck(nil); err != nil {
+		t.Errorf("expected readyzCheck to report ready once c.ready is true, got: %v", err)
+	}
+}
+
+func TestAwaitStarted_WaitsForEachRunnableToSignalStarted(t *testing.T) {
+	blocking := make(chan struct{})
+	tr := &trackedRunnable{
+		Runnable: manager.RunnableFunc(func(ctx context.Context) error {
+			<-blocking
+			return nil
+		}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go func() { _ = tr.Start(context.Background()) }()
+
+	done := make(chan error, 1)
+	go func() { done <- awaitStarted(context.Background(), []*trackedRunnable{tr}) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("awaitStarted returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("awaitStarted did not return once the runnable signalled started")
+	}
+
+	close(blocking)
+}
+
+func TestAwaitStarted_AbortsWhenContextCancelledBeforeStart(t *testing.T) {
+	tr := &trackedRunnable{
+		Runnable: manager.RunnableFunc(func(_ context.Context) error { return nil }),
+		started:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := awaitStarted(ctx, []*trackedRunnable{tr}); err == nil {
+		t.Error("expected awaitStarted to abort with an error once the context is cancelled")
+	}
+}
+
+func TestStartWithRetry_ExhaustsBudgetAndReturnsLastError(t *testing.T) {
+	var attempts int32
+	lastCallErr := errors.New("transient failure")
+	alwaysFails := manager.RunnableFunc(func(_ context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return lastCallErr
+	})
+
+	backoff := wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	err := startWithRetry(context.Background(), alwaysFails, backoff)
+	if !errors.Is(err, lastCallErr) {
+		t.Fatalf("expected startWithRetry to return the last call's error once the backoff is exhausted, got: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != int32(backoff.Steps) {
+		t.Errorf("expected exactly %d attempts, got %d", backoff.Steps, got)
+	}
+}
+
+func TestStartWithRetry_NoRetryForZeroValueBackoff(t *testing.T) {
+	var attempts int32
+	r := manager.RunnableFunc(func(_ context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("fails once")
+	})
+
+	if err := startWithRetry(context.Background(), r, wait.Backoff{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("expected exactly 1 attempt for a zero-value backoff, got %d", got)
+	}
+}
+
+func TestStartWithRetry_ContextCancellationAbortsRetryLoop(t *testing.T) {
+	var attempts int32
+	alwaysFails := manager.RunnableFunc(func(_ context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("always fails")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	backoff := wait.Backoff{Duration: 10 * time.Millisecond, Factor: 1, Steps: 1000}
+
+	start := time.Now()
+	err := startWithRetry(ctx, alwaysFails, backoff)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected startWithRetry to return an error")
+	}
+	if elapsed > time.Second {
+		t.Fatalf("startWithRetry did not honor context cancellation between attempts, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&attempts); got > 20 {
+		t.Errorf("expected retries to stop shortly after the context was cancelled, got %d attempts", got)
+	}
+}
+
+func TestRunBootstrapGroup_AbortsSiblingsOnFirstFailure(t *testing.T) {
+	blockingStarted := make(chan struct{})
+	blocking := manager.RunnableFunc(func(ctx context.Context) error {
+		close(blockingStarted)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	failing := manager.RunnableFunc(func(_ context.Context) error {
+		return errors.New("boom")
+	})
+
+	c := &ControlledRunner{}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.runBootstrapGroup(context.Background(), []manager.Runnable{blocking, failing}) }()
+
+	select {
+	case <-blockingStarted:
+	case <-time.After(time.Second):
+		t.Fatal("blocking runnable never started")
+	}
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected runBootstrapGroup to return an aggregated error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runBootstrapGroup did not return after a sibling failed; the blocking sibling was not cancelled")
+	}
+}
+
+func TestTrackedRunnable_StopCancelsConcurrentlyRunningStart(t *testing.T) {
+	started := make(chan struct{})
+	tr := &trackedRunnable{
+		Runnable: manager.RunnableFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go func() { _ = tr.Start(context.Background()) }()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("runnable never started")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		tr.stop(time.Second)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stop did not return after cancelling the running runnable")
+	}
+}
+
+func TestStop_ClosesBootstrapGroupClosers(t *testing.T) {
+	closer := &fakeCloser{}
+
+	c := &ControlledRunner{
+		BootstrapGroups: [][]manager.Runnable{
+			{manager.RunnableFunc(func(_ context.Context) error { return nil })},
+			{closer},
+		},
+	}
+
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop returned an unexpected error: %v", err)
+	}
+
+	if !closer.closed {
+		t.Error("expected Stop to close a Closer found via BootstrapGroups, not just BootstrapRunnables")
+	}
+}
+
+type fakeCloser struct {
+	closed bool
+}
+
+func (f *fakeCloser) Start(_ context.Context) error { return nil }
+
+func (f *fakeCloser) Close() error {
+	f.closed = true
+	return nil
+}